@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+)
+
+// runDecode implements `sanitiser decode [options] <input_file>`.
+func runDecode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	storeLocation := fs.String("store", "", "Location of the mapping data created by encode")
+	backend := fs.String("backend", string(store.DefaultBackend), "Mapping store backend: sqlite, badger, leveldb, postgres or fsm")
+	dsn := fs.String("dsn", "", "Connection string for the postgres backend (ignored by other backends)")
+	decoder := fs.String("decoder", "auto", "Decoding strategy: trie, regex or auto (picks trie unless the mapping store is too large)")
+	csvMode := fs.Bool("csv", false, "Treat input as CSV and decode IDs field-by-field instead of line-by-line")
+	tsvMode := fs.Bool("tsv", false, "Treat input as TSV and decode IDs field-by-field instead of line-by-line")
+	delim := fs.String("delim", "", "Explicit field delimiter, overriding -csv/-tsv and the file extension")
+	preserveHeader := fs.Bool("header", true, "When decoding CSV/TSV, leave the first row unchanged instead of scanning it for IDs")
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s decode [options] <input_file>\n\n", os.Args[0])
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(os.Stderr, "\nExample: %s decode -store=mapping.db encoded.fasta > original.fasta\n", os.Args[0])
+		_, _ = fmt.Fprintf(os.Stderr, "Use '-' as input_file to read from STDIN\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	inputFile := fs.Arg(0)
+
+	input, closeInput, err := openInput(inputFile)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	mappingStore, err := store.New(store.Options{Backend: store.Backend(*backend), Location: *storeLocation, DSN: *dsn, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error creating mapping store: %v", err)
+	}
+	defer mappingStore.Close()
+
+	delimiter, tabular := determineTabularMode(inputFile, *csvMode, *tsvMode, *delim)
+	if tabular {
+		return decodeTabular(input, mappingStore, delimiter, *preserveHeader)
+	}
+	return decodeMode(input, mappingStore, *decoder)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+)
+
+// runEncode implements `sanitiser encode [options] <input_file>`.
+func runEncode(args []string) error {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	storeLocation := fs.String("store", "", "Location to store mapping data (optional, uses current directory if not provided)")
+	backend := fs.String("backend", string(store.DefaultBackend), "Mapping store backend: sqlite, badger, leveldb, postgres or fsm")
+	dsn := fs.String("dsn", "", "Connection string for the postgres backend (ignored by other backends)")
+	trimLength := fs.Int("trim", 40, "Number of characters to keep from the header checksum (optional, uses 40 if not provided). Capped at the selected -hash algorithm's full digest length.")
+	hashAlgo := fs.String("hash", "sha1", fmt.Sprintf("Hash algorithm to derive IDs from (available: %s)", supportedHashAlgorithmTags()))
+	strict := fs.Bool("strict", false, "Fail instead of auto-extending the trim length when two distinct headers hash to the same ID")
+	batchSize := fs.Int("batch", 10000, "Number of records to buffer per mapping-store transaction")
+	inMemory := fs.Bool("inmemory", false, "Hold the mapping store in memory during encode, streaming it out to -store on completion (sqlite and badger backends only)")
+	compress := fs.String("compress", "", "Compress original headers before storing them: \"snappy\" or \"\" for none")
+	twoPass := fs.Bool("two-pass", false, "Scan the input twice (once to hash, once to emit) instead of spilling large records to a temp file. Requires a seekable input file, not stdin.")
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s encode [options] <input_file>\n\n", os.Args[0])
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(os.Stderr, "\nExample: %s encode -hash=sha256 -strict input.fasta > output.fasta\n", os.Args[0])
+		_, _ = fmt.Fprintf(os.Stderr, "Use '-' as input_file to read from STDIN\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	algo, err := lookupHashAlgorithm(*hashAlgo)
+	if err != nil {
+		return err
+	}
+
+	maxTrim := algo.new().Size() * 2 // hex digits per byte
+	if *trimLength < 1 {
+		return fmt.Errorf("trim value must be between 1 and %d for -hash=%s", maxTrim, algo.tag)
+	}
+	if *trimLength > maxTrim {
+		*trimLength = maxTrim
+	}
+
+	input, closeInput, err := openInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	mappingStore, err := store.New(store.Options{Backend: store.Backend(*backend), Location: *storeLocation, DSN: *dsn, InMemory: *inMemory, Compression: store.Compression(*compress)})
+	if err != nil {
+		return fmt.Errorf("error creating mapping store: %v", err)
+	}
+
+	err = encodeMode(input, mappingStore, algo, *trimLength, *batchSize, *twoPass, *strict)
+	closeErr := mappingStore.Close()
+	_, _ = fmt.Fprint(os.Stderr, "Closed store\n")
+	if err != nil {
+		return fmt.Errorf("error in encode mode: %v", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("error closing mapping store: %v", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+)
+
+// runLookup implements `sanitiser lookup [options] [id...]`. IDs are taken
+// from the command line if given, otherwise read one per line from stdin,
+// so it composes with `grep -o` over an encoded file.
+func runLookup(args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	storeLocation := fs.String("store", "", "Location of the mapping data created by encode")
+	backend := fs.String("backend", string(store.DefaultBackend), "Mapping store backend: sqlite, badger, leveldb, postgres or fsm")
+	dsn := fs.String("dsn", "", "Connection string for the postgres backend (ignored by other backends)")
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s lookup [options] [id...]\n\n", os.Args[0])
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(os.Stderr, "\nPrints the original header for each encoded ID, in the same order.\nWith no IDs given, reads one ID per line from STDIN.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	mappingStore, err := store.New(store.Options{Backend: store.Backend(*backend), Location: *storeLocation, DSN: *dsn, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error creating mapping store: %v", err)
+	}
+	defer mappingStore.Close()
+
+	ids := fs.Args()
+	if len(ids) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if id := scanner.Text(); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading IDs from stdin: %v", err)
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("no IDs given on the command line or on stdin")
+	}
+
+	resolved, err := mappingStore.LookupMany(ids)
+	if err != nil {
+		return fmt.Errorf("error resolving IDs: %v", err)
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+
+	misses := 0
+	for _, id := range ids {
+		header, ok := resolved[id]
+		if !ok {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: no mapping found for %s\n", id)
+			misses++
+			continue
+		}
+		if _, err := fmt.Fprintln(writer, header); err != nil {
+			return fmt.Errorf("error writing output: %v", err)
+		}
+	}
+
+	if misses > 0 {
+		return fmt.Errorf("%d/%d ID(s) had no mapping", misses, len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+)
+
+// runRemap implements `sanitiser remap [options] <input_file>`. It rewrites
+// an already-encoded FASTA file (and its mapping store) from one hash
+// algorithm to another, reusing the same recordBuffer/assignEncodedID/
+// batcher machinery as encode rather than duplicating it.
+func runRemap(args []string) error {
+	fs := flag.NewFlagSet("remap", flag.ExitOnError)
+	storeLocation := fs.String("store", "", "Location of the existing mapping data, encoded with the -from algorithm")
+	backend := fs.String("backend", string(store.DefaultBackend), "Backend of the existing mapping store")
+	dsn := fs.String("dsn", "", "Connection string for the existing mapping store's postgres backend")
+	outStoreLocation := fs.String("out-store", "", "Location to write the remapped mapping data")
+	outBackend := fs.String("out-backend", string(store.DefaultBackend), "Backend for the remapped mapping store")
+	outDSN := fs.String("out-dsn", "", "Connection string for the remapped mapping store's postgres backend")
+	fromAlgo := fs.String("from", "", "Hash algorithm the input was encoded with (required)")
+	toAlgo := fs.String("to", "", "Hash algorithm to remap to (required)")
+	trimLength := fs.Int("trim", 40, "Number of hex characters to keep from the new checksum")
+	strict := fs.Bool("strict", false, "Fail instead of auto-extending the trim length on a hash collision")
+	batchSize := fs.Int("batch", 10000, "Number of records to buffer per mapping-store transaction")
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s remap -from=<algo> -to=<algo> [options] <input_file>\n\n", os.Args[0])
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(os.Stderr, "\nRe-encodes a FASTA file previously encoded with -from into IDs hashed\nwith -to, writing the new mapping to -out-store.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *fromAlgo == "" || *toAlgo == "" {
+		return fmt.Errorf("-from and -to are both required")
+	}
+
+	from, err := lookupHashAlgorithm(*fromAlgo)
+	if err != nil {
+		return fmt.Errorf("-from: %v", err)
+	}
+	to, err := lookupHashAlgorithm(*toAlgo)
+	if err != nil {
+		return fmt.Errorf("-to: %v", err)
+	}
+
+	maxTrim := to.new().Size() * 2
+	if *trimLength < 1 || *trimLength > maxTrim {
+		return fmt.Errorf("trim value must be between 1 and %d for -to=%s", maxTrim, to.tag)
+	}
+
+	input, closeInput, err := openInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	oldStore, err := store.New(store.Options{Backend: store.Backend(*backend), Location: *storeLocation, DSN: *dsn, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error opening existing mapping store: %v", err)
+	}
+	defer oldStore.Close()
+
+	newStore, err := store.New(store.Options{Backend: store.Backend(*outBackend), Location: *outStoreLocation, DSN: *outDSN})
+	if err != nil {
+		return fmt.Errorf("error creating remapped mapping store: %v", err)
+	}
+
+	if err := remap(input, oldStore, newStore, from, to, *trimLength, *batchSize, *strict); err != nil {
+		_ = newStore.Close()
+		return err
+	}
+	return newStore.Close()
+}
+
+// remap reads each record's old encoded ID from input, resolves its
+// original header through oldStore, re-hashes the sequence with "to" and
+// writes the new ID plus sequence to stdout, recording the new mapping in
+// newStore.
+func remap(input io.Reader, oldStore, newStore store.MappingStore, from, to hashAlgorithm, trimLength, batchSize int, strict bool) error {
+	batch := newBatcher(newStore, batchSize)
+	writer := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if err := writer.Flush(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error flushing writer: %v\n", err)
+		}
+	}()
+
+	seen := make(map[string]string)
+	index := -1
+	var currentHeader string
+	var hasher hash.Hash
+	var buf *recordBuffer
+
+	flush := func() error {
+		if hasher == nil {
+			return nil
+		}
+		defer buf.close()
+
+		newID, err := assignEncodedID(seen, index, to.tag, currentHeader, hasher.Sum(nil), trimLength, strict)
+		if err != nil {
+			return err
+		}
+		if err := batch.add(newID, currentHeader); err != nil {
+			return fmt.Errorf("error storing mapping: %v", err)
+		}
+		if _, err := fmt.Fprintf(writer, ">%s\n", newID); err != nil {
+			return fmt.Errorf("error writing sequence: %v", err)
+		}
+		if err := buf.writeTo(writer); err != nil {
+			return fmt.Errorf("error writing sequence: %v", err)
+		}
+		return nil
+	}
+
+	err := scanFasta(input,
+		func(oldID string) error {
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if algoTag, _, ok := parseEncodedID(oldID); ok && algoTag != from.tag {
+				_, _ = fmt.Fprintf(os.Stderr, "Warning: %s looks like it was hashed with %q, not -from=%q\n", oldID, algoTag, from.tag)
+			}
+
+			header, err := oldStore.LookupOriginalID(oldID)
+			if err != nil {
+				return fmt.Errorf("error resolving %s: %v", oldID, err)
+			}
+
+			index++
+			currentHeader = header
+			hasher = to.new()
+			buf = &recordBuffer{}
+			return nil
+		},
+		func(line string) error {
+			if _, err := io.WriteString(hasher, line); err != nil {
+				return fmt.Errorf("error hashing sequence: %v", err)
+			}
+			return buf.writeLine(line)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("error processing sequence: %v", err)
+	}
+
+	if err := batch.flush(); err != nil {
+		return fmt.Errorf("error flushing final batch: %v", err)
+	}
+	if err := newStore.Finalise(); err != nil {
+		return fmt.Errorf("error finalising mapping store: %v", err)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Remapping completed. %d sequences remapped from %s to %s.\n", index+1, from.tag, to.tag)
+	return nil
+}
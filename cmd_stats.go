@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+)
+
+// candidateTrimLengths are the trim lengths runStats reports a collision
+// rate for. A length longer than an ID's own stored hex prefix can't be
+// evaluated retroactively (the fuller digest was never kept), so it's
+// simply skipped for that ID rather than guessed at.
+var candidateTrimLengths = []int{8, 12, 16, 24, 32, 40, 64}
+
+// runStats implements `sanitiser stats [options]`. It reports on the
+// original headers and encoded IDs in a mapping store: header-length
+// spread and, for a handful of candidate trim lengths, how often two
+// distinct headers would collide if the stored IDs were truncated that
+// short. "Sequence length" isn't reported because the store only ever
+// retains headers, not sequence bytes.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	storeLocation := fs.String("store", "", "Location of the mapping data created by encode")
+	backend := fs.String("backend", string(store.DefaultBackend), "Mapping store backend: sqlite, badger, leveldb, postgres or fsm")
+	dsn := fs.String("dsn", "", "Connection string for the postgres backend (ignored by other backends)")
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s stats [options]\n\n", os.Args[0])
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintf(os.Stderr, "\nReports header-length and collision-rate statistics for a mapping store.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	mappingStore, err := store.New(store.Options{Backend: store.Backend(*backend), Location: *storeLocation, DSN: *dsn, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error creating mapping store: %v", err)
+	}
+	defer mappingStore.Close()
+
+	mapping, err := mappingStore.ReadAllMappings()
+	if err != nil {
+		return fmt.Errorf("error reading mapping store: %v", err)
+	}
+	if len(mapping) == 0 {
+		fmt.Println("Mapping store is empty")
+		return nil
+	}
+
+	lengths := make([]int, 0, len(mapping))
+	for _, header := range mapping {
+		lengths = append(lengths, len(header))
+	}
+	sort.Ints(lengths)
+
+	fmt.Printf("Records:            %d\n", len(mapping))
+	fmt.Printf("Header length (min/median/max): %d / %d / %d\n", lengths[0], lengths[len(lengths)/2], lengths[len(lengths)-1])
+
+	fmt.Println("Collision rate by trim length (of records whose stored ID is at least that long):")
+	for _, trim := range candidateTrimLengths {
+		rate, evaluated := collisionRate(mapping, trim)
+		if evaluated == 0 {
+			fmt.Printf("  %2d hex chars: no records stored with a prefix this long\n", trim)
+			continue
+		}
+		fmt.Printf("  %2d hex chars: %.4f%% (%d records evaluated)\n", trim, rate*100, evaluated)
+	}
+
+	if *storeLocation != "" {
+		size, err := dirSize(*storeLocation)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: could not determine store size: %v\n", err)
+		} else {
+			fmt.Printf("Store size:         %d bytes\n", size)
+		}
+	}
+
+	return nil
+}
+
+// collisionRate truncates every ID's already-stored hex prefix to trim
+// characters and reports what fraction of the records whose stored prefix
+// is at least that long collide with another record at that length. IDs
+// whose stored prefix is shorter than trim can't be evaluated, since the
+// rest of their digest was never kept, and are excluded from the count.
+func collisionRate(mapping map[string]string, trim int) (rate float64, evaluated int) {
+	counts := make(map[string]int)
+	for newID := range mapping {
+		if newID == "" {
+			continue
+		}
+		_, hexPrefix, ok := parseEncodedID(newID)
+		if !ok || len(hexPrefix) < trim {
+			continue
+		}
+		counts[hexPrefix[:trim]]++
+	}
+
+	evaluated = 0
+	collided := 0
+	for _, count := range counts {
+		evaluated += count
+		if count > 1 {
+			collided += count
+		}
+	}
+	if evaluated == 0 {
+		return 0, 0
+	}
+	return float64(collided) / float64(evaluated), evaluated
+}
+
+// dirSize sums the size of every regular file under path, or returns a
+// single file's size if path isn't a directory. It's used to report the
+// on-disk footprint of file-backed stores (sqlite/badger/leveldb/fsm);
+// postgres stores have no local path to measure.
+func dirSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	var total int64
+	err = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// hashAlgorithm is one pluggable ID-hashing scheme: the short tag
+// embedded in encoded IDs (see idFormat) that lets decode tell which
+// algorithm a given ID was hashed with, and a constructor for a fresh
+// hash.Hash.
+type hashAlgorithm struct {
+	tag string
+	new func() hash.Hash
+}
+
+// hashAlgorithms holds every algorithm compiled into this binary. sha1
+// and sha256 are always available; blake3 and xxh3 register themselves
+// from hashalgo_blake3.go and hashalgo_xxh3.go, each built only under its
+// matching build tag so the default binary carries no extra dependency.
+var hashAlgorithms = map[string]hashAlgorithm{}
+
+func registerHashAlgorithm(tag string, newHash func() hash.Hash) {
+	hashAlgorithms[tag] = hashAlgorithm{tag: tag, new: newHash}
+}
+
+func init() {
+	registerHashAlgorithm("sha1", func() hash.Hash { return sha1.New() })
+	registerHashAlgorithm("sha256", func() hash.Hash { return sha256.New() })
+}
+
+// lookupHashAlgorithm resolves the -hash flag value to a registered
+// algorithm, or a descriptive error listing what this binary was
+// actually built with.
+func lookupHashAlgorithm(tag string) (hashAlgorithm, error) {
+	algo, ok := hashAlgorithms[tag]
+	if !ok {
+		return hashAlgorithm{}, fmt.Errorf("unknown hash algorithm %q (available: %s)", tag, supportedHashAlgorithmTags())
+	}
+	return algo, nil
+}
+
+func supportedHashAlgorithmTags() string {
+	tags := make([]string, 0, len(hashAlgorithms))
+	for tag := range hashAlgorithms {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ", ")
+}
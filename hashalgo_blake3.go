@@ -0,0 +1,13 @@
+//go:build blake3
+
+package main
+
+import (
+	"hash"
+
+	"github.com/zeebo/blake3"
+)
+
+func init() {
+	registerHashAlgorithm("blake3", func() hash.Hash { return blake3.New() })
+}
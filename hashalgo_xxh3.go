@@ -0,0 +1,13 @@
+//go:build xxh3
+
+package main
+
+import (
+	"hash"
+
+	"github.com/zeebo/xxh3"
+)
+
+func init() {
+	registerHashAlgorithm("xxh3", func() hash.Hash { return xxh3.New() })
+}
@@ -2,111 +2,314 @@ package main
 
 import (
 	"bufio"
-	"crypto/sha1"
+	"bytes"
+	"encoding/csv"
 	"encoding/hex"
-	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+	"github.com/CorinYeatsCGPS/sanitise-fasta/trie"
 )
 
-const (
-	idFormat      = "%d_PW_%s"
-	idRegexFormat = `\d+_PW_[a-f0-9]+`
+// idFormat is index_PW_algo_hexprefix: the algo tag lets decode resolve
+// IDs produced by whichever -hash algorithm this binary was built with,
+// even when a single mapping store mixes records encoded by different
+// algorithms or trim lengths across runs.
+const idFormat = "%d_PW_%s_%s"
+
+var (
+	idRegexOnce     sync.Once
+	idRegexCompiled *regexp.Regexp
 )
 
-func main() {
-	storeLocation := flag.String("store", "", "Location to store mapping data (optional, uses current directory if not provided)")
-	trimLength := flag.Int("trim", 40, "Number of characters to keep from the SHA1 checksum (optional, uses 40 if not provided). Maximum is 40.")
-	csvMode := flag.Bool("csv", false, "Enable CSV mode for decoding (puts original IDs in quotes)")
+// idRegex lazily compiles a regex matching any encoded ID this binary
+// knows how to produce: `\d+_PW_(?:(?:sha1|sha256|...)_)?[a-f0-9]+`. The
+// algo tag is optional in the pattern so IDs written before this format
+// existed (no tag, implicitly sha1) still decode alongside newer tagged
+// ones in the same store.
+func idRegex() *regexp.Regexp {
+	idRegexOnce.Do(func() {
+		tags := make([]string, 0, len(hashAlgorithms))
+		for tag := range hashAlgorithms {
+			tags = append(tags, regexp.QuoteMeta(tag))
+		}
+		sort.Strings(tags)
+		idRegexCompiled = regexp.MustCompile(fmt.Sprintf(`\d+_PW_(?:(?:%s)_)?[a-f0-9]+`, strings.Join(tags, "|")))
+	})
+	return idRegexCompiled
+}
 
-	flag.Usage = func() {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [options] [encode|decode] <input_file>\n\n", os.Args[0])
-		_, _ = fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		_, _ = fmt.Fprintf(os.Stderr, "\nExample usage:\n")
-		_, _ = fmt.Fprintf(os.Stderr, "  Encode: %s encode input.fasta > output.fasta\n", os.Args[0])
-		_, _ = fmt.Fprintf(os.Stderr, "  Decode: %s decode input.txt > output.txt\n", os.Args[0])
-		_, _ = fmt.Fprintf(os.Stderr, "  Decode CSV: %s -csv decode input.csv > output.csv\n", os.Args[0])
-		_, _ = fmt.Fprintf(os.Stderr, "  Use '-' as input_file to read from STDIN\n")
+// determineTabularMode decides whether decode should run the structured
+// CSV/TSV pipeline instead of the plain-text decoder, and which delimiter
+// to use. Precedence: an explicit -delim wins, then -tsv/-csv, then the
+// file extension.
+func determineTabularMode(inputFile string, csvMode, tsvMode bool, delimFlag string) (delimiter rune, tabular bool) {
+	if delimFlag != "" {
+		return rune(delimFlag[0]), true
+	}
+	if tsvMode {
+		return '\t', true
+	}
+	if csvMode {
+		return ',', true
 	}
 
-	flag.Parse()
+	lower := strings.ToLower(inputFile)
+	switch {
+	case strings.HasSuffix(lower, ".tsv"):
+		return '\t', true
+	case strings.HasSuffix(lower, ".csv"):
+		return ',', true
+	}
+	return 0, false
+}
+
+func encodeMode(input io.Reader, mappingStore store.MappingStore, algo hashAlgorithm, trimLength, batchSize int, twoPass, strict bool) error {
+	if twoPass {
+		seeker, ok := input.(io.Seeker)
+		if !ok {
+			return fmt.Errorf("-two-pass requires a seekable input file, not stdin")
+		}
+		return encodeModeTwoPass(input, seeker, mappingStore, algo, trimLength, batchSize, strict)
+	}
+	return encodeModeStreaming(input, mappingStore, algo, trimLength, batchSize, strict)
+}
 
-	args := flag.Args()
-	if len(args) != 2 || (args[0] != "encode" && args[0] != "decode") {
-		flag.Usage()
-		os.Exit(1)
+// assignEncodedID picks a new_id for (index, header, digest) that hasn't
+// already been claimed by a different header in this run. It starts from
+// trimLength hex characters of digest and, on a collision, extends the
+// prefix in 4-character steps until it's unique or the whole digest has
+// been used — no re-hashing needed, since the full digest is already in
+// hand. With strict set, any collision is a hard error instead.
+//
+// seen is keyed on algo+"_"+prefix, not the full new_id: new_id also
+// embeds the record's index, which is unique per record by construction,
+// so keying on new_id itself would make every lookup a guaranteed miss
+// and the whole collision check a no-op.
+func assignEncodedID(seen map[string]string, index int, algo, header string, digest []byte, trimLength int, strict bool) (string, error) {
+	hexDigest := hex.EncodeToString(digest)
+	trim := trimLength
+	if trim > len(hexDigest) {
+		trim = len(hexDigest)
 	}
 
-	mode := args[0]
-	inputFile := args[1]
+	for {
+		prefix := hexDigest[:trim]
+		key := algo + "_" + prefix
+		existing, collided := seen[key]
+		if !collided || existing == header {
+			seen[key] = header
+			return fmt.Sprintf(idFormat, index+1, algo, prefix), nil
+		}
+
+		if strict {
+			return "", fmt.Errorf("hash collision on %s between %q and %q (rerun without -strict to auto-extend the trim length)", key, existing, header)
+		}
+		if trim >= len(hexDigest) {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: %s collides with %q at full digest length; keeping duplicate ID\n", key, existing)
+			seen[key] = header
+			return fmt.Sprintf(idFormat, index+1, algo, prefix), nil
+		}
 
-	if *trimLength < 1 || *trimLength > 40 {
-		_, _ = fmt.Fprintf(os.Stderr, "Error: trim value must be between 1 and 40\n")
-		os.Exit(1)
+		trim += 4
+		if trim > len(hexDigest) {
+			trim = len(hexDigest)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s collides with %q; extending trim length to %d\n", key, existing, trim)
 	}
+}
+
+// scanFasta walks a FASTA file's lines, skipping blank lines and '#'/';'
+// comments, and calls onHeader once per record (the text after '>') and
+// onLine once per sequence line (already trimmed), in input order. It
+// centralises the parsing shared by the streaming and two-pass encoders
+// so neither duplicates the blank/comment handling or the "is this even
+// FASTA" validation.
+func scanFasta(input io.Reader, onHeader func(header string) error, onLine func(line string) error) error {
+	scanner := bufio.NewScanner(input)
+
+	// Increase the buffer size to handle larger lines
+	const maxCapacity = 20 * 1024 * 1024 // 20MB
+	buf := make([]byte, maxCapacity)
+	scanner.Buffer(buf, maxCapacity)
+
+	seenHeader := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, ">") {
+			seenHeader = true
+			if err := onHeader(line[1:]); err != nil {
+				return err
+			}
+			continue
+		}
 
-	if mode == "encode" && *csvMode {
-		_, _ = fmt.Fprintf(os.Stderr, "Error: CSV mode (-csv) is only applicable for decode mode\n")
-		os.Exit(1)
+		if !seenHeader {
+			return fmt.Errorf("input is not a valid FASTA file: first valid line does not start with '>'")
+		}
+		if err := onLine(line); err != nil {
+			return err
+		}
 	}
 
-	// Automatically enable CSV mode if the input file has a .csv or .tsv extension
-	if mode == "decode" && isCSVFile(inputFile) {
-		*csvMode = true
-		_, _ = fmt.Fprintf(os.Stderr, "CSV mode automatically enabled for file with .csv or .tsv extension\n")
+	if !seenHeader {
+		return fmt.Errorf("error reading input: empty file or only blank/comment lines")
 	}
+	return scanner.Err()
+}
 
-	var input io.Reader
-	if inputFile == "-" {
-		input = os.Stdin
-	} else {
-		file, err := os.Open(inputFile)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
-			os.Exit(1)
+// encodeModeStreaming hashes and emits each record as its lines arrive:
+// sequence bytes are written straight into the rolling hash and into a
+// per-record recordBuffer, never concatenated into a single in-memory
+// string the way the old currentSequence += line loop did. Because the
+// encoded header has to precede the sequence body in the output, but the
+// header's hash isn't known until the record's last line has been seen,
+// each record's body is held in recordBuffer (memory, spilling to a temp
+// file past spillThreshold) until the hash finalises and the header can
+// be written.
+func encodeModeStreaming(input io.Reader, mappingStore store.MappingStore, algo hashAlgorithm, trimLength, batchSize int, strict bool) error {
+	batch := newBatcher(mappingStore, batchSize)
+	writer := bufio.NewWriter(os.Stdout)
+	defer func() {
+		if err := writer.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error flushing writer: %v\n", err)
 		}
-		defer file.Close()
-		input = file
-	}
+	}()
 
-	switch mode {
-	case "encode":
-		mappingStore, err := NewMappingStore(*storeLocation, false)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error creating mapping store: %v\n", err)
-			os.Exit(1)
+	seen := make(map[string]string)
+	index := -1
+	var currentHeader string
+	var hasher hash.Hash
+	var buf *recordBuffer
+
+	flush := func() error {
+		if hasher == nil {
+			return nil
 		}
-		err = encodeMode(input, mappingStore, *trimLength)
-		closeErr := mappingStore.Close()
-		fmt.Fprint(os.Stderr, "Closed store\n")
+		defer buf.close()
+
+		newID, err := assignEncodedID(seen, index, algo.tag, currentHeader, hasher.Sum(nil), trimLength, strict)
 		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error in encode mode: %v\n", err)
-			os.Exit(1)
+			return err
 		}
-		if closeErr != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error closing mapping store: %v\n", closeErr)
-			os.Exit(1)
+
+		if err := batch.add(newID, currentHeader); err != nil {
+			return fmt.Errorf("error storing mapping: %v", err)
 		}
-	case "decode":
-		mappingStore, err := NewMappingStore(*storeLocation, true)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error creating mapping store: %v\n", err)
-			os.Exit(1)
+		if _, err := fmt.Fprintf(writer, ">%s\n", newID); err != nil {
+			return fmt.Errorf("error writing sequence: %v", err)
 		}
-		defer mappingStore.Close()
-		if err := decodeMode(input, mappingStore, *csvMode); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error in decode mode: %v\n", err)
-			os.Exit(1)
+		if err := buf.writeTo(writer); err != nil {
+			return fmt.Errorf("error writing sequence: %v", err)
 		}
+		return nil
+	}
+
+	err := scanFasta(input,
+		func(header string) error {
+			if err := flush(); err != nil {
+				return err
+			}
+			index++
+			currentHeader = header
+			hasher = algo.new()
+			buf = &recordBuffer{}
+			return nil
+		},
+		func(line string) error {
+			if _, err := io.WriteString(hasher, line); err != nil {
+				return fmt.Errorf("error hashing sequence: %v", err)
+			}
+			return buf.writeLine(line)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("error processing sequence: %v", err)
 	}
+
+	// Commit whatever is left in the final, possibly-partial batch.
+	if err := batch.flush(); err != nil {
+		return fmt.Errorf("error flushing final batch: %v", err)
+	}
+
+	if err := mappingStore.Finalise(); err != nil {
+		return fmt.Errorf("error finalising mapping store: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Encoding completed. %d sequences encoded.\n", index+1)
+
+	return nil
 }
 
-func encodeMode(input io.Reader, mappingStore *MappingStore, trimLength int) error {
-	scanner := bufio.NewScanner(input)
+// encodeModeTwoPass trades encodeModeStreaming's per-record temp-file
+// spill for a second full read of input: the first pass only computes
+// each record's hash and stores its mapping, the second rewinds and
+// re-emits the sequence lines as they're re-read, by which point every
+// record's new_id is already known. No sequence data is ever buffered.
+func encodeModeTwoPass(input io.Reader, seeker io.Seeker, mappingStore store.MappingStore, algo hashAlgorithm, trimLength, batchSize int, strict bool) error {
+	batch := newBatcher(mappingStore, batchSize)
+
+	seen := make(map[string]string)
+	var newIDs []string
+	var currentHeader string
+	var hasher hash.Hash
+	index := -1
+
+	finishRecord := func() error {
+		if hasher == nil {
+			return nil
+		}
+		newID, err := assignEncodedID(seen, index, algo.tag, currentHeader, hasher.Sum(nil), trimLength, strict)
+		if err != nil {
+			return err
+		}
+		if err := batch.add(newID, currentHeader); err != nil {
+			return fmt.Errorf("error storing mapping: %v", err)
+		}
+		newIDs = append(newIDs, newID)
+		return nil
+	}
+
+	err := scanFasta(input,
+		func(header string) error {
+			if err := finishRecord(); err != nil {
+				return err
+			}
+			index++
+			currentHeader = header
+			hasher = algo.new()
+			return nil
+		},
+		func(line string) error {
+			_, err := io.WriteString(hasher, line)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := finishRecord(); err != nil {
+		return fmt.Errorf("error processing sequence: %v", err)
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error rewinding input for emit pass: %v", err)
+	}
+
 	writer := bufio.NewWriter(os.Stdout)
 	defer func() {
 		if err := writer.Flush(); err != nil {
@@ -114,88 +317,232 @@ func encodeMode(input io.Reader, mappingStore *MappingStore, trimLength int) err
 		}
 	}()
 
-	// Increase the buffer size to handle larger lines
-	const maxCapacity = 20 * 1024 * 1024 // 20MB
-	buf := make([]byte, maxCapacity)
-	scanner.Buffer(buf, maxCapacity)
+	recordIndex := -1
+	err = scanFasta(input,
+		func(header string) error {
+			recordIndex++
+			_, err := fmt.Fprintf(writer, ">%s\n", newIDs[recordIndex])
+			return err
+		},
+		func(line string) error {
+			_, err := fmt.Fprintln(writer, line)
+			return err
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error writing sequence: %v", err)
+	}
 
-	// Skip blank lines and lines starting with a '#' or ';', and find the first valid line
-	var firstLine string
-	for scanner.Scan() {
-		firstLine = strings.TrimSpace(scanner.Text())
-		if firstLine != "" && !strings.HasPrefix(firstLine, "#") && !strings.HasPrefix(firstLine, ";") {
-			break
+	if err := batch.flush(); err != nil {
+		return fmt.Errorf("error flushing final batch: %v", err)
+	}
+	if err := mappingStore.Finalise(); err != nil {
+		return fmt.Errorf("error finalising mapping store: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Encoding completed. %d sequences encoded.\n", len(newIDs))
+	return nil
+}
+
+// spillThreshold caps how much of a single record's sequence body
+// recordBuffer holds in memory before spilling the rest to a temp file.
+const spillThreshold = 8 * 1024 * 1024 // 8MB
+
+// recordBuffer accumulates one record's encoded sequence lines so they
+// can be written out once the record's hash (and therefore its header)
+// is known. It starts as an in-memory buffer and, past spillThreshold,
+// spills to a temp file, so a single chromosome-scale record can't force
+// the whole encode pass to hold gigabytes in memory.
+type recordBuffer struct {
+	mem  bytes.Buffer
+	file *os.File
+}
+
+func (b *recordBuffer) writeLine(line string) error {
+	if b.file != nil {
+		_, err := fmt.Fprintln(b.file, line)
+		return err
+	}
+	if b.mem.Len()+len(line)+1 > spillThreshold {
+		file, err := os.CreateTemp("", "sanitise-fasta-seq-*")
+		if err != nil {
+			return fmt.Errorf("spilling sequence buffer to disk: %v", err)
+		}
+		if _, err := file.Write(b.mem.Bytes()); err != nil {
+			return fmt.Errorf("spilling sequence buffer to disk: %v", err)
 		}
+		b.mem.Reset()
+		b.file = file
+		_, err = fmt.Fprintln(b.file, line)
+		return err
 	}
+	_, err := fmt.Fprintln(&b.mem, line)
+	return err
+}
 
-	// Check if we reached EOF without finding a valid line
-	if firstLine == "" {
-		return fmt.Errorf("error reading input: empty file or only blank/comment lines")
+// writeTo copies the buffered record body to w. The recordBuffer is
+// spent after this call; callers must close it afterwards.
+func (b *recordBuffer) writeTo(w io.Writer) error {
+	if b.file != nil {
+		if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, b.file)
+		return err
 	}
+	_, err := w.Write(b.mem.Bytes())
+	return err
+}
 
-	// Check if the first valid line starts with ">"
-	if !strings.HasPrefix(firstLine, ">") {
-		return fmt.Errorf("input is not a valid FASTA file: first valid line does not start with '>'")
+func (b *recordBuffer) close() error {
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	if err := b.file.Close(); err != nil {
+		return err
 	}
+	return os.Remove(name)
+}
 
-	currentHeader := firstLine[1:]
-	currentSequence := ""
-	index := 0
+// batcher buffers mapping-store writes and flushes them as a single
+// MappingStore.Transact call once batchSize records have accumulated,
+// amortising the per-record transaction overhead that makes one
+// autocommit INSERT per sequence unusable for multi-million-record
+// inputs.
+type batcher struct {
+	store     store.MappingStore
+	batchSize int
+	pending   []mappingPair
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") || !strings.HasPrefix(firstLine, ";") {
-			continue // Skip blank lines and lines starting with '#' or ';'
-		}
-		if strings.HasPrefix(line, ">") {
-			if currentHeader != "" {
-				if err := processSequence(currentHeader, currentSequence, index, writer, trimLength, mappingStore); err != nil {
-					return fmt.Errorf("error processing sequence: %v", err)
-				}
-				index++
+type mappingPair struct {
+	newID, originalHeader string
+}
+
+func newBatcher(s store.MappingStore, batchSize int) *batcher {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &batcher{store: s, batchSize: batchSize}
+}
+
+func (b *batcher) add(newID, originalHeader string) error {
+	b.pending = append(b.pending, mappingPair{newID, originalHeader})
+	if len(b.pending) >= b.batchSize {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush commits whatever is pending, including a final partial batch.
+// StorePair is idempotent per new_id, so retrying a failed Transact call
+// with the same pending slice is safe.
+func (b *batcher) flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	pending := b.pending
+	err := b.store.Transact(func(tx store.Tx) error {
+		for _, p := range pending {
+			if err := tx.StorePair(p.newID, p.originalHeader); err != nil {
+				return err
 			}
-			currentHeader = line[1:]
-			currentSequence = ""
-		} else {
-			currentSequence += line
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if currentHeader != "" {
-		if err := processSequence(currentHeader, currentSequence, index, writer, trimLength, mappingStore); err != nil {
-			return fmt.Errorf("error processing sequence: %v", err)
+	b.pending = b.pending[:0]
+	return nil
+}
+
+// maxTrieMappings caps how many mappings the "auto" decoder will load into
+// a trie. Above this, the trie would use more memory than is worth trading
+// for the single-pass speedup, so auto falls back to the batched-regex path
+// instead. auto still reads every mapping with ReadAllMappings to count
+// them, so the fallback does not avoid holding the full mapping in memory.
+const maxTrieMappings = 2_000_000
+
+func decodeMode(input io.Reader, mappingStore store.MappingStore, decoder string) error {
+	switch decoder {
+	case "trie":
+		mapping, err := mappingStore.ReadAllMappings()
+		if err != nil {
+			return fmt.Errorf("error reading mapping store for trie decoder: %v", err)
+		}
+		return decodeWithTrie(input, mapping)
+	case "regex":
+		return decodeWithBatchedRegex(input, mappingStore)
+	case "auto", "":
+		mapping, err := mappingStore.ReadAllMappings()
+		if err != nil {
+			return fmt.Errorf("error reading mapping store for trie decoder: %v", err)
 		}
+		if len(mapping) <= maxTrieMappings {
+			return decodeWithTrie(input, mapping)
+		}
+		fmt.Fprintf(os.Stderr, "Mapping store has %d entries (> %d); falling back to the batched-regex decoder\n", len(mapping), maxTrieMappings)
+		return decodeWithBatchedRegex(input, mappingStore)
+	default:
+		return fmt.Errorf("unknown decoder %q: want trie, regex or auto", decoder)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading input: %v", err)
+// decodeWithTrie builds an Aho-Corasick automaton once from every new_id in
+// mapping, then streams the input in a single pass per line: O(line length)
+// rather than the O(lines x mappings) of the original strings.ReplaceAll
+// loop, or the one-lookup-per-occurrence cost of the regex path.
+func decodeWithTrie(input io.Reader, mapping map[string]string) error {
+	patterns := make([]string, 0, len(mapping))
+	for newID := range mapping {
+		patterns = append(patterns, newID)
 	}
+	automaton := trie.New(patterns)
 
-	fmt.Fprintf(os.Stderr, "Encoding completed. %d sequences encoded.\n", index+1)
+	scanner := bufio.NewScanner(input)
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
 
-	return nil
-}
+	const maxCapacity = 10 * 1024 * 1024 // 10MB
+	buf := make([]byte, maxCapacity)
+	scanner.Buffer(buf, maxCapacity)
 
-func processSequence(header, sequence string, index int, writer *bufio.Writer, trimLength int, mappingStore *MappingStore) error {
-	hash := sha1.Sum([]byte(sequence))
-	trimmedHash := hex.EncodeToString(hash[:])[:trimLength]
-	newID := fmt.Sprintf(idFormat, index+1, trimmedHash)
-	newHeader := fmt.Sprintf(">%s", newID)
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		matches := automaton.FindAll(line)
+
+		var out strings.Builder
+		cursor := 0
+		for _, m := range matches {
+			out.Write(line[cursor:m.Start])
+			out.WriteString(mapping[m.Pattern])
+			cursor = m.End
+		}
+		out.Write(line[cursor:])
 
-	// Store the mapping directly
-	if err := mappingStore.StorePair(newID, header); err != nil {
-		return fmt.Errorf("error storing mapping: %v", err)
+		if _, err := fmt.Fprintln(writer, out.String()); err != nil {
+			return fmt.Errorf("error writing output at line %d: %v", lineNum, err)
+		}
+		lineNum++
 	}
 
-	_, err := fmt.Fprintf(writer, "%s\n%s\n", newHeader, sequence)
-	if err != nil {
-		return fmt.Errorf("error writing sequence: %v", err)
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading input: %v", err)
 	}
 
 	return nil
 }
 
-func decodeMode(input io.Reader, mappingStore *MappingStore, csvMode bool) error {
+// decodeWithBatchedRegex is the fallback for mapping stores too large to
+// load into a trie: it still finds matches with a single regex pass per
+// line, but resolves every match on that line with one LookupMany call
+// instead of one query per occurrence.
+func decodeWithBatchedRegex(input io.Reader, mappingStore store.MappingStore) error {
 	scanner := bufio.NewScanner(input)
 	writer := bufio.NewWriter(os.Stdout)
 	defer writer.Flush()
@@ -205,35 +552,29 @@ func decodeMode(input io.Reader, mappingStore *MappingStore, csvMode bool) error
 	buf := make([]byte, maxCapacity)
 	scanner.Buffer(buf, maxCapacity)
 
-	// Regular expression to match the encoded IDs
-	re := regexp.MustCompile(idRegexFormat)
+	re := idRegex()
 
 	lineNum := 0
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		// Find all matches in the line
 		matches := re.FindAllString(line, -1)
-
 		if len(matches) > 0 {
-			// Create a map of replacements
-			replacements := make(map[string]string)
+			resolved, err := mappingStore.LookupMany(matches)
+			if err != nil {
+				return fmt.Errorf("error resolving IDs at line %d: %v", lineNum, err)
+			}
+
+			replacements := make(map[string]string, len(matches))
 			for _, match := range matches {
-				originalID, err := mappingStore.LookupOriginalID(match)
-				if err == nil {
-					if csvMode {
-						// Escape any existing double quotes in the original ID
-						originalID = strings.ReplaceAll(originalID, `"`, `""`)
-						// Wrap the original ID in double quotes
-						originalID = fmt.Sprintf(`"%s"`, originalID)
-					}
-					replacements[match] = originalID
-				} else {
-					_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not decode ID %s: %v\n", match, err)
+				originalID, ok := resolved[match]
+				if !ok {
+					_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not decode ID %s\n", match)
+					continue
 				}
+				replacements[match] = originalID
 			}
 
-			// Perform a single pass replacement
 			for oldID, newID := range replacements {
 				line = strings.ReplaceAll(line, oldID, newID)
 			}
@@ -253,7 +594,69 @@ func decodeMode(input io.Reader, mappingStore *MappingStore, csvMode bool) error
 	return nil
 }
 
-func isCSVFile(filename string) bool {
-	lowercaseFilename := strings.ToLower(filename)
-	return strings.HasSuffix(lowercaseFilename, ".csv") || strings.HasSuffix(lowercaseFilename, ".tsv")
+// decodeTabular decodes a CSV/TSV file field-by-field through encoding/csv,
+// replacing it decodeMode's line-oriented regex/trie matching (which knew
+// nothing about quoting, so an original header containing the delimiter or
+// a newline would silently corrupt the row it landed in). preserveHeader
+// passes the first record through unchanged rather than scanning it for
+// IDs, since header columns are never themselves encoded IDs.
+func decodeTabular(input io.Reader, mappingStore store.MappingStore, delimiter rune, preserveHeader bool) error {
+	reader := csv.NewReader(input)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Comma = delimiter
+	defer writer.Flush()
+
+	re := idRegex()
+
+	rowNum := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading row %d: %v", rowNum, err)
+		}
+
+		if rowNum == 0 && preserveHeader {
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("error writing header row: %v", err)
+			}
+			rowNum++
+			continue
+		}
+
+		for i, field := range record {
+			matches := re.FindAllString(field, -1)
+			if len(matches) == 0 {
+				continue
+			}
+
+			resolved, err := mappingStore.LookupMany(matches)
+			if err != nil {
+				return fmt.Errorf("error resolving IDs at row %d: %v", rowNum, err)
+			}
+
+			for _, match := range matches {
+				originalID, ok := resolved[match]
+				if !ok {
+					_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not decode ID %s\n", match)
+					continue
+				}
+				field = strings.ReplaceAll(field, match, originalID)
+			}
+			record[i] = field
+		}
+
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("error writing row %d: %v", rowNum, err)
+		}
+		rowNum++
+	}
+
+	writer.Flush()
+	return writer.Error()
 }
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CorinYeatsCGPS/sanitise-fasta/store"
+)
+
+// captureStdout redirects os.Stdout to a pipe for the duration of fn and
+// returns everything written to it. encodeMode/decodeMode write straight to
+// os.Stdout rather than taking an io.Writer, so tests have to swap the
+// global out from under them instead of injecting one.
+func captureStdout(tb testing.TB, fn func()) []byte {
+	tb.Helper()
+
+	original := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		tb.Fatalf("creating pipe: %v", err)
+	}
+	os.Stdout = w
+
+	done := make(chan []byte, 1)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+
+	fn()
+
+	os.Stdout = original
+	_ = w.Close()
+	out := <-done
+	_ = r.Close()
+	return out
+}
+
+// genFasta builds a synthetic multi-record FASTA with records records,
+// each roughly seqLen bases long, so tests and benchmarks don't depend on
+// a fixture file on disk. Each record's length is nudged by its index so
+// records hash to genuinely distinct IDs instead of colliding with each
+// other, which would otherwise make every test run exercise the
+// collision-extension path instead of the ordinary one.
+func genFasta(records, seqLen int) string {
+	var buf bytes.Buffer
+	bases := "ACGT"
+	for i := 0; i < records; i++ {
+		fmt.Fprintf(&buf, ">record_%d some description\n", i)
+		recordLen := seqLen + i
+		for written := 0; written < recordLen; written += 60 {
+			end := written + 60
+			if end > recordLen {
+				end = recordLen
+			}
+			for j := written; j < end; j++ {
+				buf.WriteByte(bases[j%len(bases)])
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String()
+}
+
+// TestEncodeDecodeRoundTrip encodes a small multi-record FASTA against an
+// fsm mapping store (CGO-free and file-backed, so it runs in any Go
+// environment) and confirms decode recovers the original headers exactly.
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	input := genFasta(5, 237) // records of 237..241 bases: all but record 3 (240) end on a partial 60-base line
+	storeLocation := filepath.Join(t.TempDir(), "mapping.fsm")
+
+	algo, err := lookupHashAlgorithm("sha1")
+	if err != nil {
+		t.Fatalf("lookupHashAlgorithm: %v", err)
+	}
+
+	writeStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: storeLocation})
+	if err != nil {
+		t.Fatalf("creating write store: %v", err)
+	}
+
+	encoded := captureStdout(t, func() {
+		if err := encodeMode(strings.NewReader(input), writeStore, algo, 40, 1000, false, false); err != nil {
+			t.Fatalf("encodeMode: %v", err)
+		}
+	})
+	if err := writeStore.Close(); err != nil {
+		t.Fatalf("closing write store: %v", err)
+	}
+
+	readStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: storeLocation, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("creating read store: %v", err)
+	}
+	defer readStore.Close()
+
+	decoded := captureStdout(t, func() {
+		if err := decodeMode(bytes.NewReader(encoded), readStore, "regex"); err != nil {
+			t.Fatalf("decodeMode: %v", err)
+		}
+	})
+
+	gotHeaders := extractHeaders(string(decoded))
+	wantHeaders := extractHeaders(input)
+	if len(gotHeaders) != len(wantHeaders) {
+		t.Fatalf("got %d decoded headers, want %d", len(gotHeaders), len(wantHeaders))
+	}
+	for i, want := range wantHeaders {
+		if gotHeaders[i] != want {
+			t.Errorf("record %d: decoded header %q, want %q", i, gotHeaders[i], want)
+		}
+	}
+}
+
+// TestEncodeModeStreamingMatchesTwoPass checks that -two-pass produces the
+// same IDs as the default streaming path for identical input, since both
+// are meant to be interchangeable.
+func TestEncodeModeStreamingMatchesTwoPass(t *testing.T) {
+	input := genFasta(8, 123)
+	algo, err := lookupHashAlgorithm("sha256")
+	if err != nil {
+		t.Fatalf("lookupHashAlgorithm: %v", err)
+	}
+
+	streamingOut := captureStdout(t, func() {
+		writeStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: filepath.Join(t.TempDir(), "streaming.fsm")})
+		if err != nil {
+			t.Fatalf("creating store: %v", err)
+		}
+		defer writeStore.Close()
+		if err := encodeMode(strings.NewReader(input), writeStore, algo, 16, 1000, false, false); err != nil {
+			t.Fatalf("streaming encodeMode: %v", err)
+		}
+	})
+
+	inputFile := filepath.Join(t.TempDir(), "input.fasta")
+	if err := os.WriteFile(inputFile, []byte(input), 0644); err != nil {
+		t.Fatalf("writing input file: %v", err)
+	}
+
+	twoPassOut := captureStdout(t, func() {
+		file, err := os.Open(inputFile)
+		if err != nil {
+			t.Fatalf("opening input file: %v", err)
+		}
+		defer file.Close()
+
+		writeStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: filepath.Join(t.TempDir(), "twopass.fsm")})
+		if err != nil {
+			t.Fatalf("creating store: %v", err)
+		}
+		defer writeStore.Close()
+		if err := encodeMode(file, writeStore, algo, 16, 1000, true, false); err != nil {
+			t.Fatalf("two-pass encodeMode: %v", err)
+		}
+	})
+
+	gotIDs := extractHeaders(string(streamingOut))
+	wantIDs := extractHeaders(string(twoPassOut))
+	if len(gotIDs) != len(wantIDs) {
+		t.Fatalf("streaming produced %d records, two-pass produced %d", len(gotIDs), len(wantIDs))
+	}
+	for i := range wantIDs {
+		if gotIDs[i] != wantIDs[i] {
+			t.Errorf("record %d: streaming ID %q, two-pass ID %q", i, gotIDs[i], wantIDs[i])
+		}
+	}
+}
+
+// TestDecodeTrieSubstringIDs exercises the shape of ID that broke the trie
+// decoder: a short-trim or collision-extended ID (e.g. "9_PW_sha1_1") that
+// is a literal substring of a longer, earlier-starting ID
+// ("19_PW_sha1_188fa", which contains it at offset 1). The trie decoder
+// must still resolve the full, earlier-starting match rather than letting
+// the shorter one that happens to end first shadow it. Both "trie" and
+// "auto" route through the same code path, so both are checked.
+func TestDecodeTrieSubstringIDs(t *testing.T) {
+	mappings := map[string]string{
+		"19_PW_sha1_188fa": "header number 18",
+		"9_PW_sha1_1":      "a different, unrelated header",
+	}
+
+	for _, decoder := range []string{"trie", "auto"} {
+		t.Run(decoder, func(t *testing.T) {
+			storeLocation := filepath.Join(t.TempDir(), "mapping.fsm")
+			writeStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: storeLocation})
+			if err != nil {
+				t.Fatalf("creating write store: %v", err)
+			}
+			for newID, header := range mappings {
+				if err := writeStore.StorePair(newID, header); err != nil {
+					t.Fatalf("StorePair(%s): %v", newID, err)
+				}
+			}
+			if err := writeStore.Finalise(); err != nil {
+				t.Fatalf("Finalise: %v", err)
+			}
+			if err := writeStore.Close(); err != nil {
+				t.Fatalf("closing write store: %v", err)
+			}
+
+			readStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: storeLocation, ReadOnly: true})
+			if err != nil {
+				t.Fatalf("creating read store: %v", err)
+			}
+			defer readStore.Close()
+
+			out := captureStdout(t, func() {
+				if err := decodeMode(strings.NewReader(">19_PW_sha1_188fa header number 18\n"), readStore, decoder); err != nil {
+					t.Fatalf("decodeMode: %v", err)
+				}
+			})
+
+			want := ">header number 18 header number 18"
+			if got := strings.TrimRight(string(out), "\n"); got != want {
+				t.Errorf("decoder=%s: got %q, want %q", decoder, got, want)
+			}
+		})
+	}
+}
+
+// extractHeaders pulls the text of every ">" header line, in order, out of
+// a FASTA-shaped string.
+func extractHeaders(fasta string) []string {
+	var headers []string
+	for _, line := range strings.Split(fasta, "\n") {
+		if strings.HasPrefix(line, ">") {
+			headers = append(headers, line[1:])
+		}
+	}
+	return headers
+}
+
+// BenchmarkEncodeModeStreaming measures encodeModeStreaming's throughput on
+// a synthetic chromosome-scale record (tens of megabytes of sequence in a
+// single record, the case the streaming rewrite exists for): run with
+// -bench=Streaming -benchtime=... against a larger seqLen to project
+// multi-GB behaviour, since committing an actual multi-GB fixture isn't
+// practical for a repository.
+func BenchmarkEncodeModeStreaming(b *testing.B) {
+	benchmarkEncodeMode(b, false)
+}
+
+// BenchmarkEncodeModeTwoPass is BenchmarkEncodeModeStreaming's -two-pass
+// counterpart, for comparing the spill-to-disk and rewind-and-reread
+// strategies at the same input size.
+func BenchmarkEncodeModeTwoPass(b *testing.B) {
+	benchmarkEncodeMode(b, true)
+}
+
+func benchmarkEncodeMode(b *testing.B, twoPass bool) {
+	const seqLen = 20 * 1024 * 1024 // 20MB single record, standing in for a chromosome-scale input
+	input := genFasta(1, seqLen)
+	algo, err := lookupHashAlgorithm("sha1")
+	if err != nil {
+		b.Fatalf("lookupHashAlgorithm: %v", err)
+	}
+
+	var inputFile string
+	if twoPass {
+		inputFile = filepath.Join(b.TempDir(), "bench.fasta")
+		if err := os.WriteFile(inputFile, []byte(input), 0644); err != nil {
+			b.Fatalf("writing input file: %v", err)
+		}
+	}
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		writeStore, err := store.New(store.Options{Backend: store.BackendFSM, Location: filepath.Join(b.TempDir(), fmt.Sprintf("bench-%d.fsm", i))})
+		if err != nil {
+			b.Fatalf("creating store: %v", err)
+		}
+
+		var reader io.Reader
+		var closeReader func()
+		if twoPass {
+			file, err := os.Open(inputFile)
+			if err != nil {
+				b.Fatalf("opening input file: %v", err)
+			}
+			reader = file
+			closeReader = func() { _ = file.Close() }
+		} else {
+			reader = strings.NewReader(input)
+			closeReader = func() {}
+		}
+
+		captureStdout(b, func() {
+			if err := encodeMode(reader, writeStore, algo, 40, 1000, twoPass, false); err != nil {
+				b.Fatalf("encodeMode: %v", err)
+			}
+		})
+
+		closeReader()
+		_ = writeStore.Close()
+	}
+}
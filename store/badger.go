@@ -0,0 +1,176 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// badgerStore is the dgraph-io/badger/v3 backed MappingStore. It avoids the
+// CGO dependency that SQLite pulls in, at the cost of a dedicated process
+// lock on the store directory (readers and writers cannot overlap).
+//
+// inMemory and diskLocation track Options.InMemory: writes land in a
+// memory-only badger instance and Finalise copies them into an on-disk
+// instance at diskLocation.
+type badgerStore struct {
+	db           *badger.DB
+	inMemory     bool
+	diskLocation string
+}
+
+func newBadgerStore(opts Options) (MappingStore, error) {
+	location := opts.Location
+	if location == "" {
+		location = "mapping_store"
+	}
+
+	if opts.InMemory && !opts.ReadOnly {
+		badgerOpts := badger.DefaultOptions("").WithInMemory(true)
+		badgerOpts.Logger = nil
+		badgerOpts.WithLoggingLevel(badger.ERROR)
+
+		db, err := badger.Open(badgerOpts)
+		if err != nil {
+			return nil, fmt.Errorf("store: opening in-memory badger store: %v", err)
+		}
+		return &badgerStore{db: db, inMemory: true, diskLocation: location}, nil
+	}
+
+	badgerOpts := badger.DefaultOptions(location)
+	badgerOpts.ReadOnly = opts.ReadOnly
+	badgerOpts.Logger = nil
+	badgerOpts.WithLoggingLevel(badger.ERROR)
+
+	db, err := badger.Open(badgerOpts)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening badger store: %v. Note: this backend cannot be opened twice concurrently", err)
+	}
+
+	return &badgerStore{db: db}, nil
+}
+
+func (s *badgerStore) StorePair(newID, originalHeader string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(newID), []byte(originalHeader))
+	})
+}
+
+func (s *badgerStore) LookupOriginalID(newID string) (string, error) {
+	var originalHeader string
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(newID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			originalHeader = string(val)
+			return nil
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("store: looking up %s: %v", newID, err)
+	}
+	return originalHeader, nil
+}
+
+// LookupMany has no batched-read primitive in Badger, so it falls back to
+// one LookupOriginalID per ID.
+func (s *badgerStore) LookupMany(newIDs []string) (map[string]string, error) {
+	return lookupManyBySingleLookups(s, newIDs)
+}
+
+// Transact runs fn inside a single badger.DB.Update, so a batch of writes
+// hits the value log and LSM tree once instead of once per record.
+func (s *badgerStore) Transact(fn func(Tx) error) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTx{txn: txn})
+	})
+}
+
+// badgerTx is the Tx passed into a badgerStore.Transact callback.
+type badgerTx struct {
+	txn *badger.Txn
+}
+
+func (t *badgerTx) StorePair(newID, originalHeader string) error {
+	return t.txn.Set([]byte(newID), []byte(originalHeader))
+}
+
+func (s *badgerStore) ReadAllMappings() (map[string]string, error) {
+	mapping := make(map[string]string)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			newID := string(item.KeyCopy(nil))
+			err := item.Value(func(val []byte) error {
+				mapping[newID] = string(val)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("store: reading all mappings: %v", err)
+	}
+	return mapping, nil
+}
+
+func (s *badgerStore) Finalise() error {
+	if s.inMemory {
+		if err := s.streamToDisk(); err != nil {
+			return err
+		}
+	}
+	return s.db.Flatten(1)
+}
+
+// streamToDisk copies every pair from the in-memory badger instance into a
+// fresh on-disk instance at diskLocation, then swaps s.db to point at it so
+// a caller that keeps using the store after Finalise sees the same data.
+func (s *badgerStore) streamToDisk() error {
+	mapping, err := s.ReadAllMappings()
+	if err != nil {
+		return fmt.Errorf("store: reading in-memory mappings: %v", err)
+	}
+
+	diskOpts := badger.DefaultOptions(s.diskLocation)
+	diskOpts.Logger = nil
+	diskOpts.WithLoggingLevel(badger.ERROR)
+
+	diskDB, err := badger.Open(diskOpts)
+	if err != nil {
+		return fmt.Errorf("store: opening disk badger store %s: %v", s.diskLocation, err)
+	}
+
+	err = diskDB.Update(func(txn *badger.Txn) error {
+		for newID, originalHeader := range mapping {
+			if err := txn.Set([]byte(newID), []byte(originalHeader)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = diskDB.Close()
+		return fmt.Errorf("store: streaming in-memory mapping to disk: %v", err)
+	}
+
+	inMemoryDB := s.db
+	s.db = diskDB
+	s.inMemory = false
+	return inMemoryDB.Close()
+}
+
+func (s *badgerStore) InMemory() bool {
+	return s.inMemory
+}
+
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+// Compression identifies the codec used to compress an original header
+// before it reaches the backend. NCBI/Ensembl headers routinely run to
+// hundreds of repetitive bytes ("gi|...|ref|NC_..."), so compressing them
+// roughly halves mapping-store size on large RefSeq-scale dumps.
+type Compression string
+
+const (
+	CompressionNone   Compression = "none"
+	CompressionSnappy Compression = "snappy"
+)
+
+// compressionMetaKey is an ordinary mapping row, stored and read back
+// through the same StorePair/LookupOriginalID calls used for real records.
+// It records which codec a given store was written with, so opening an
+// older, uncompressed store just falls back to CompressionNone instead of
+// failing to decode.
+const compressionMetaKey = "__sanitise_fasta_compression__"
+
+// compressingStore wraps a MappingStore to transparently compress original
+// headers on the way in and decompress them on the way out. Because it
+// only ever calls the MappingStore interface, it works unchanged with any
+// backend.
+type compressingStore struct {
+	MappingStore
+	write    Compression
+	detected Compression
+}
+
+func newCompressingStore(underlying MappingStore, write Compression, readOnly bool) (MappingStore, error) {
+	cs := &compressingStore{MappingStore: underlying, write: write}
+
+	if readOnly {
+		codec, err := underlying.LookupOriginalID(compressionMetaKey)
+		if err != nil {
+			cs.detected = CompressionNone
+		} else {
+			cs.detected = Compression(codec)
+		}
+		return cs, nil
+	}
+
+	if err := underlying.StorePair(compressionMetaKey, string(write)); err != nil {
+		return nil, fmt.Errorf("store: recording compression codec: %v", err)
+	}
+	cs.detected = write
+	return cs, nil
+}
+
+func (c *compressingStore) StorePair(newID, originalHeader string) error {
+	encoded, err := compress(c.write, originalHeader)
+	if err != nil {
+		return err
+	}
+	return c.MappingStore.StorePair(newID, encoded)
+}
+
+func (c *compressingStore) LookupOriginalID(newID string) (string, error) {
+	raw, err := c.MappingStore.LookupOriginalID(newID)
+	if err != nil {
+		return "", err
+	}
+	return decompress(c.detected, raw)
+}
+
+func (c *compressingStore) LookupMany(newIDs []string) (map[string]string, error) {
+	raw, err := c.MappingStore.LookupMany(newIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]string, len(raw))
+	for newID, header := range raw {
+		decoded, err := decompress(c.detected, header)
+		if err != nil {
+			return nil, err
+		}
+		found[newID] = decoded
+	}
+	return found, nil
+}
+
+func (c *compressingStore) ReadAllMappings() (map[string]string, error) {
+	raw, err := c.MappingStore.ReadAllMappings()
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]string, len(raw))
+	for newID, header := range raw {
+		if newID == compressionMetaKey {
+			continue
+		}
+		decoded, err := decompress(c.detected, header)
+		if err != nil {
+			return nil, err
+		}
+		mapping[newID] = decoded
+	}
+	return mapping, nil
+}
+
+// Transact wraps the underlying Tx so StorePair calls made inside a batch
+// are compressed the same way as top-level ones.
+func (c *compressingStore) Transact(fn func(Tx) error) error {
+	return c.MappingStore.Transact(func(tx Tx) error {
+		return fn(&compressingTx{Tx: tx, codec: c.write})
+	})
+}
+
+type compressingTx struct {
+	Tx
+	codec Compression
+}
+
+func (t *compressingTx) StorePair(newID, originalHeader string) error {
+	encoded, err := compress(t.codec, originalHeader)
+	if err != nil {
+		return err
+	}
+	return t.Tx.StorePair(newID, encoded)
+}
+
+func compress(codec Compression, s string) (string, error) {
+	switch codec {
+	case CompressionSnappy:
+		return string(snappy.Encode(nil, []byte(s))), nil
+	case CompressionNone, "":
+		return s, nil
+	default:
+		return "", fmt.Errorf("store: unknown compression codec %q", codec)
+	}
+}
+
+func decompress(codec Compression, s string) (string, error) {
+	switch codec {
+	case CompressionSnappy:
+		decoded, err := snappy.Decode(nil, []byte(s))
+		if err != nil {
+			return "", fmt.Errorf("store: decompressing header: %v", err)
+		}
+		return string(decoded), nil
+	case CompressionNone, "":
+		return s, nil
+	default:
+		return "", fmt.Errorf("store: unknown compression codec %q", codec)
+	}
+}
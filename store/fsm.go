@@ -0,0 +1,348 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+
+	mmap "github.com/edsrzf/mmap-go"
+)
+
+// The .fsm ("fasta sanitiser mapping") format is a CGO-free alternative to
+// the sqlite backend for callers that only need new_id -> original_header
+// round-tripping: a magic+version header, an append-only stream of
+// length-prefixed, CRC-checked records, and a footer holding a sorted
+// index of new_id -> file offset. Encode appends records with no
+// per-insert transaction overhead; Finalise writes the footer once, and
+// decode memory-maps the file and binary-searches the index.
+const (
+	fsmMagic       = "FSM1"
+	fsmVersion     = byte(1)
+	fsmHeaderSize  = len(fsmMagic) + 1
+	fsmFooterMagic = "FSMX"
+	fsmTrailerSize = 8 + len(fsmFooterMagic) // footer offset + magic
+)
+
+// fsmIndexEntry is one entry of the sorted footer index: new_id, the byte
+// offset of its record, and the record's total length.
+type fsmIndexEntry struct {
+	NewID  string
+	Offset int64
+	Length int32
+}
+
+// fsmStore is either a write-mode appender (file, writer, writeIndex) or a
+// read-mode mmap + parsed index; never both.
+type fsmStore struct {
+	readOnly bool
+	location string
+
+	file       *os.File
+	writer     *bufio.Writer
+	offset     int64
+	writeIndex []fsmIndexEntry
+
+	mapped    mmap.MMap
+	readIndex []fsmIndexEntry
+}
+
+func newFSMStore(opts Options) (MappingStore, error) {
+	location := opts.Location
+	if location == "" {
+		location = "mapping_store.fsm"
+	}
+
+	if opts.ReadOnly {
+		return openFSMReadOnly(location)
+	}
+	return openFSMReadWrite(location)
+}
+
+func openFSMReadWrite(location string) (MappingStore, error) {
+	file, err := os.OpenFile(location, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening fsm file %s: %v", location, err)
+	}
+
+	writer := bufio.NewWriter(file)
+	if _, err := writer.WriteString(fsmMagic); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("store: writing fsm header: %v", err)
+	}
+	if err := writer.WriteByte(fsmVersion); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("store: writing fsm header: %v", err)
+	}
+
+	return &fsmStore{
+		location: location,
+		file:     file,
+		writer:   writer,
+		offset:   int64(fsmHeaderSize),
+	}, nil
+}
+
+func openFSMReadOnly(location string) (MappingStore, error) {
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening fsm file %s: %v", location, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("store: stat-ing fsm file: %v", err)
+	}
+	if info.Size() < int64(fsmHeaderSize+fsmTrailerSize) {
+		_ = file.Close()
+		return nil, fmt.Errorf("store: %s is too small to be a valid .fsm file", location)
+	}
+
+	mapped, err := mmap.Map(file, mmap.RDONLY, 0)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("store: memory-mapping fsm file: %v", err)
+	}
+
+	if string(mapped[:len(fsmMagic)]) != fsmMagic {
+		_ = mapped.Unmap()
+		_ = file.Close()
+		return nil, fmt.Errorf("store: %s is not a .fsm file (bad magic)", location)
+	}
+	if mapped[len(fsmMagic)] != fsmVersion {
+		_ = mapped.Unmap()
+		_ = file.Close()
+		return nil, fmt.Errorf("store: %s has unsupported .fsm version %d", location, mapped[len(fsmMagic)])
+	}
+
+	trailer := mapped[len(mapped)-fsmTrailerSize:]
+	footerOffset := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	if string(trailer[8:]) != fsmFooterMagic {
+		_ = mapped.Unmap()
+		_ = file.Close()
+		return nil, fmt.Errorf("store: %s footer is corrupt (bad trailer magic)", location)
+	}
+	if footerOffset < int64(fsmHeaderSize) || footerOffset > int64(len(mapped)-fsmTrailerSize) {
+		_ = mapped.Unmap()
+		_ = file.Close()
+		return nil, fmt.Errorf("store: %s footer offset %d is out of range (corrupt .fsm file)", location, footerOffset)
+	}
+
+	index, err := parseFSMFooter(mapped[footerOffset : len(mapped)-fsmTrailerSize])
+	if err != nil {
+		_ = mapped.Unmap()
+		_ = file.Close()
+		return nil, fmt.Errorf("store: parsing fsm footer: %v", err)
+	}
+
+	return &fsmStore{readOnly: true, location: location, file: file, mapped: mapped, readIndex: index}, nil
+}
+
+// writeFSMRecord appends a length-prefixed, CRC-checked (new_id,
+// original_header) record and returns its total length in bytes.
+func writeFSMRecord(w *bufio.Writer, newID, originalHeader string) (int32, error) {
+	var lenBuf [4]byte
+	payload := append([]byte(newID), []byte(originalHeader)...)
+	checksum := crc32.ChecksumIEEE(payload)
+
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(newID)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.WriteString(newID); err != nil {
+		return 0, err
+	}
+
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(originalHeader)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.WriteString(originalHeader); err != nil {
+		return 0, err
+	}
+
+	binary.LittleEndian.PutUint32(lenBuf[:], checksum)
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return 0, err
+	}
+
+	return int32(4 + len(newID) + 4 + len(originalHeader) + 4), nil
+}
+
+// parseFSMRecord reads one record back out of buf (exactly Length bytes,
+// as sliced using an fsmIndexEntry) and verifies its checksum.
+func parseFSMRecord(buf []byte) (newID, originalHeader string, err error) {
+	if len(buf) < 8 {
+		return "", "", fmt.Errorf("record too short")
+	}
+	newIDLen := binary.LittleEndian.Uint32(buf[0:4])
+	pos := 4 + int(newIDLen)
+	if pos+4 > len(buf) {
+		return "", "", fmt.Errorf("record truncated")
+	}
+	newID = string(buf[4:pos])
+
+	headerLen := binary.LittleEndian.Uint32(buf[pos : pos+4])
+	pos += 4
+	if pos+int(headerLen)+4 > len(buf) {
+		return "", "", fmt.Errorf("record truncated")
+	}
+	originalHeader = string(buf[pos : pos+int(headerLen)])
+	pos += int(headerLen)
+
+	wantChecksum := binary.LittleEndian.Uint32(buf[pos : pos+4])
+	gotChecksum := crc32.ChecksumIEEE(append([]byte(newID), []byte(originalHeader)...))
+	if wantChecksum != gotChecksum {
+		return "", "", fmt.Errorf("checksum mismatch for %s (corrupt .fsm file)", newID)
+	}
+
+	return newID, originalHeader, nil
+}
+
+// parseFSMFooter reads the sorted (new_id, offset, length) index written
+// by Finalise.
+func parseFSMFooter(buf []byte) ([]fsmIndexEntry, error) {
+	var index []fsmIndexEntry
+	pos := 0
+	for pos < len(buf) {
+		if pos+4 > len(buf) {
+			return nil, fmt.Errorf("footer truncated")
+		}
+		keyLen := int(binary.LittleEndian.Uint32(buf[pos : pos+4]))
+		pos += 4
+		if pos+keyLen+8+4 > len(buf) {
+			return nil, fmt.Errorf("footer truncated")
+		}
+		newID := string(buf[pos : pos+keyLen])
+		pos += keyLen
+		offset := int64(binary.LittleEndian.Uint64(buf[pos : pos+8]))
+		pos += 8
+		length := int32(binary.LittleEndian.Uint32(buf[pos : pos+4]))
+		pos += 4
+
+		index = append(index, fsmIndexEntry{NewID: newID, Offset: offset, Length: length})
+	}
+	return index, nil
+}
+
+func (s *fsmStore) StorePair(newID, originalHeader string) error {
+	if s.readOnly {
+		return fmt.Errorf("store: fsm store opened read-only")
+	}
+
+	offset := s.offset
+	length, err := writeFSMRecord(s.writer, newID, originalHeader)
+	if err != nil {
+		return fmt.Errorf("store: appending record: %v", err)
+	}
+	s.offset += int64(length)
+	s.writeIndex = append(s.writeIndex, fsmIndexEntry{NewID: newID, Offset: offset, Length: length})
+	return nil
+}
+
+// Transact has no batching to do: append is already a single sequential
+// write per record with no per-insert transaction, so it just runs fn
+// against the store directly.
+func (s *fsmStore) Transact(fn func(Tx) error) error {
+	return fn(s)
+}
+
+func (s *fsmStore) LookupOriginalID(newID string) (string, error) {
+	if !s.readOnly {
+		return "", fmt.Errorf("store: fsm store opened for writing, cannot look up")
+	}
+
+	i := sort.Search(len(s.readIndex), func(i int) bool { return s.readIndex[i].NewID >= newID })
+	if i >= len(s.readIndex) || s.readIndex[i].NewID != newID {
+		return "", fmt.Errorf("store: no mapping found for %s", newID)
+	}
+
+	entry := s.readIndex[i]
+	_, originalHeader, err := parseFSMRecord(s.mapped[entry.Offset : entry.Offset+int64(entry.Length)])
+	if err != nil {
+		return "", fmt.Errorf("store: reading record for %s: %v", newID, err)
+	}
+	return originalHeader, nil
+}
+
+func (s *fsmStore) LookupMany(newIDs []string) (map[string]string, error) {
+	return lookupManyBySingleLookups(s, newIDs)
+}
+
+func (s *fsmStore) ReadAllMappings() (map[string]string, error) {
+	if !s.readOnly {
+		return nil, fmt.Errorf("store: fsm store opened for writing, cannot read all mappings")
+	}
+
+	mapping := make(map[string]string, len(s.readIndex))
+	for _, entry := range s.readIndex {
+		newID, originalHeader, err := parseFSMRecord(s.mapped[entry.Offset : entry.Offset+int64(entry.Length)])
+		if err != nil {
+			return nil, fmt.Errorf("store: reading record at offset %d: %v", entry.Offset, err)
+		}
+		mapping[newID] = originalHeader
+	}
+	return mapping, nil
+}
+
+// Finalise sorts the index accumulated during encode and appends it as a
+// footer: each entry's (new_id, offset, length), followed by an 8-byte
+// footer offset and a trailer magic so decode can find it without
+// scanning the whole file.
+func (s *fsmStore) Finalise() error {
+	if s.readOnly {
+		return nil
+	}
+
+	sort.Slice(s.writeIndex, func(i, j int) bool { return s.writeIndex[i].NewID < s.writeIndex[j].NewID })
+
+	footerOffset := s.offset
+	var buf [8]byte
+	for _, entry := range s.writeIndex {
+		binary.LittleEndian.PutUint32(buf[:4], uint32(len(entry.NewID)))
+		if _, err := s.writer.Write(buf[:4]); err != nil {
+			return fmt.Errorf("store: writing footer: %v", err)
+		}
+		if _, err := s.writer.WriteString(entry.NewID); err != nil {
+			return fmt.Errorf("store: writing footer: %v", err)
+		}
+		binary.LittleEndian.PutUint64(buf[:8], uint64(entry.Offset))
+		if _, err := s.writer.Write(buf[:8]); err != nil {
+			return fmt.Errorf("store: writing footer: %v", err)
+		}
+		binary.LittleEndian.PutUint32(buf[:4], uint32(entry.Length))
+		if _, err := s.writer.Write(buf[:4]); err != nil {
+			return fmt.Errorf("store: writing footer: %v", err)
+		}
+	}
+
+	binary.LittleEndian.PutUint64(buf[:8], uint64(footerOffset))
+	if _, err := s.writer.Write(buf[:8]); err != nil {
+		return fmt.Errorf("store: writing footer trailer: %v", err)
+	}
+	if _, err := s.writer.WriteString(fsmFooterMagic); err != nil {
+		return fmt.Errorf("store: writing footer trailer: %v", err)
+	}
+
+	return s.writer.Flush()
+}
+
+func (s *fsmStore) InMemory() bool {
+	return false
+}
+
+func (s *fsmStore) Close() error {
+	if s.readOnly {
+		if s.mapped != nil {
+			if err := s.mapped.Unmap(); err != nil {
+				_ = s.file.Close()
+				return fmt.Errorf("store: unmapping fsm file: %v", err)
+			}
+		}
+		return s.file.Close()
+	}
+	return s.file.Close()
+}
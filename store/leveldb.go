@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// levelDBStore is the syndtr/goleveldb backed MappingStore. Like Badger it
+// is a pure-Go embedded store, but with a smaller on-disk footprint for
+// write-once/read-many workloads such as ours.
+type levelDBStore struct {
+	db *leveldb.DB
+}
+
+func newLevelDBStore(opts Options) (MappingStore, error) {
+	location := opts.Location
+	if location == "" {
+		location = "mapping_store_leveldb"
+	}
+
+	db, err := leveldb.OpenFile(location, &opt.Options{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("store: opening leveldb store: %v", err)
+	}
+
+	return &levelDBStore{db: db}, nil
+}
+
+func (s *levelDBStore) StorePair(newID, originalHeader string) error {
+	if err := s.db.Put([]byte(newID), []byte(originalHeader), nil); err != nil {
+		return fmt.Errorf("store: inserting mapping: %v", err)
+	}
+	return nil
+}
+
+func (s *levelDBStore) LookupOriginalID(newID string) (string, error) {
+	val, err := s.db.Get([]byte(newID), nil)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return "", fmt.Errorf("store: no mapping found for %s", newID)
+		}
+		return "", fmt.Errorf("store: looking up %s: %v", newID, err)
+	}
+	return string(val), nil
+}
+
+// LookupMany has no batched-read primitive in LevelDB, so it falls back to
+// one Get per ID.
+func (s *levelDBStore) LookupMany(newIDs []string) (map[string]string, error) {
+	return lookupManyBySingleLookups(s, newIDs)
+}
+
+// Transact runs fn against a single leveldb.Batch, applied with one Write
+// call once fn returns successfully.
+func (s *levelDBStore) Transact(fn func(Tx) error) error {
+	batch := new(leveldb.Batch)
+	if err := fn(&levelDBTx{batch: batch}); err != nil {
+		return err
+	}
+	if err := s.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("store: writing batch: %v", err)
+	}
+	return nil
+}
+
+// levelDBTx is the Tx passed into a levelDBStore.Transact callback.
+type levelDBTx struct {
+	batch *leveldb.Batch
+}
+
+func (t *levelDBTx) StorePair(newID, originalHeader string) error {
+	t.batch.Put([]byte(newID), []byte(originalHeader))
+	return nil
+}
+
+func (s *levelDBStore) ReadAllMappings() (map[string]string, error) {
+	mapping := make(map[string]string)
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		mapping[string(iter.Key())] = string(iter.Value())
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("store: reading all mappings: %v", err)
+	}
+	return mapping, nil
+}
+
+func (s *levelDBStore) Finalise() error {
+	// A nil range compacts the whole keyspace.
+	return s.db.CompactRange(util.Range{})
+}
+
+// InMemory is always false: the leveldb backend does not support
+// Options.InMemory.
+func (s *levelDBStore) InMemory() bool {
+	return false
+}
+
+func (s *levelDBStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// postgresStore is the lib/pq backed MappingStore. Unlike the embedded
+// backends it is addressed by DSN rather than Location, letting a fleet of
+// encode workers share one mapping table.
+type postgresStore struct {
+	db *sql.DB
+}
+
+func newPostgresStore(opts Options) (MappingStore, error) {
+	if opts.DSN == "" {
+		return nil, fmt.Errorf("store: postgres backend requires a DSN (-dsn)")
+	}
+
+	db, err := sql.Open("postgres", opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening postgres connection: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("store: connecting to postgres: %v", err)
+	}
+
+	if !opts.ReadOnly {
+		// original_header is BYTEA, not TEXT: with -compress=snappy the
+		// bytes handed to StorePair are an arbitrary compressed blob (may
+		// contain 0x00 and isn't necessarily valid UTF-8), which a TEXT
+		// column rejects.
+		if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS mapping (
+            new_id TEXT PRIMARY KEY,
+            original_header BYTEA
+        )`); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("store: creating table: %v", err)
+		}
+	}
+
+	return &postgresStore{db: db}, nil
+}
+
+func (s *postgresStore) StorePair(newID, originalHeader string) error {
+	_, err := s.db.Exec(`INSERT INTO mapping (new_id, original_header) VALUES ($1, $2)
+        ON CONFLICT (new_id) DO UPDATE SET original_header = excluded.original_header`, newID, []byte(originalHeader))
+	if err != nil {
+		return fmt.Errorf("store: inserting mapping: %v", err)
+	}
+	return nil
+}
+
+func (s *postgresStore) LookupOriginalID(newID string) (string, error) {
+	var originalHeader []byte
+	err := s.db.QueryRow("SELECT original_header FROM mapping WHERE new_id = $1", newID).Scan(&originalHeader)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("store: no mapping found for %s", newID)
+		}
+		return "", fmt.Errorf("store: looking up %s: %v", newID, err)
+	}
+	return string(originalHeader), nil
+}
+
+// Transact runs fn inside a single BEGIN/COMMIT.
+func (s *postgresStore) Transact(fn func(Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("store: beginning transaction: %v", err)
+	}
+
+	if err := fn(&postgresTx{tx: tx}); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("store: transaction failed: %v (rollback also failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("store: committing transaction: %v", err)
+	}
+	return nil
+}
+
+// postgresTx is the Tx passed into a postgresStore.Transact callback.
+type postgresTx struct {
+	tx *sql.Tx
+}
+
+func (t *postgresTx) StorePair(newID, originalHeader string) error {
+	_, err := t.tx.Exec(`INSERT INTO mapping (new_id, original_header) VALUES ($1, $2)
+        ON CONFLICT (new_id) DO UPDATE SET original_header = excluded.original_header`, newID, []byte(originalHeader))
+	if err != nil {
+		return fmt.Errorf("store: inserting mapping: %v", err)
+	}
+	return nil
+}
+
+// LookupMany resolves newIDs with a single
+// "SELECT new_id, original_header FROM mapping WHERE new_id = ANY($1)"
+// instead of one round trip per ID.
+func (s *postgresStore) LookupMany(newIDs []string) (map[string]string, error) {
+	if len(newIDs) == 0 {
+		return map[string]string{}, nil
+	}
+
+	rows, err := s.db.Query("SELECT new_id, original_header FROM mapping WHERE new_id = ANY($1)", pq.Array(newIDs))
+	if err != nil {
+		return nil, fmt.Errorf("store: batch querying mappings: %v", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]string, len(newIDs))
+	for rows.Next() {
+		var newID string
+		var originalHeader []byte
+		if err := rows.Scan(&newID, &originalHeader); err != nil {
+			return nil, fmt.Errorf("store: scanning row: %v", err)
+		}
+		found[newID] = string(originalHeader)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: iterating rows: %v", err)
+	}
+
+	return found, nil
+}
+
+func (s *postgresStore) ReadAllMappings() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT new_id, original_header FROM mapping")
+	if err != nil {
+		return nil, fmt.Errorf("store: querying mappings: %v", err)
+	}
+	defer rows.Close()
+
+	mapping := make(map[string]string)
+	for rows.Next() {
+		var newID string
+		var originalHeader []byte
+		if err := rows.Scan(&newID, &originalHeader); err != nil {
+			return nil, fmt.Errorf("store: scanning row: %v", err)
+		}
+		mapping[newID] = string(originalHeader)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: iterating rows: %v", err)
+	}
+
+	return mapping, nil
+}
+
+func (s *postgresStore) Finalise() error {
+	if _, err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_mapping_new_id ON mapping (new_id)"); err != nil {
+		return fmt.Errorf("store: creating index: %v", err)
+	}
+	if _, err := s.db.Exec("ANALYZE mapping"); err != nil {
+		return fmt.Errorf("store: analyzing table: %v", err)
+	}
+	return nil
+}
+
+// InMemory is always false: Postgres already lives off-host, so there's no
+// local hot-write-path mode to opt into.
+func (s *postgresStore) InMemory() bool {
+	return false
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,342 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore is the database/sql + mattn/go-sqlite3 backed MappingStore.
+// It is the default backend: no external server to stand up, and fast
+// enough for single-host runs once journalling is tuned for bulk writes.
+//
+// schemaVersion lets read-only callers (decode) dispatch to
+// version-appropriate SQL via originalHeaderColumn instead of assuming the
+// columns the current binary would have written. diskLocation and
+// inMemory track the Options.InMemory hot-write-path mode: writes land in
+// a shared in-memory database and Finalise streams them out to
+// diskLocation.
+type sqliteStore struct {
+	db            *sql.DB
+	schemaVersion int
+	inMemory      bool
+	diskLocation  string
+}
+
+func newSQLiteStore(opts Options) (MappingStore, error) {
+	location := opts.Location
+	if location == "" {
+		location = "mapping_store.db"
+	}
+
+	if opts.InMemory && !opts.ReadOnly {
+		return newInMemorySQLiteStore(location)
+	}
+
+	if dir := filepath.Dir(location); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("store: creating directory for sqlite store: %v", err)
+		}
+	}
+
+	var db *sql.DB
+	var version int
+	var err error
+	if opts.ReadOnly {
+		db, err = openSQLiteReadOnly(location)
+		if err == nil {
+			version, err = readSchemaVersionReadOnly(db)
+		}
+	} else {
+		db, err = openSQLiteReadWrite(location)
+		if err == nil {
+			err = migrateSQLite(db)
+		}
+		if err == nil {
+			version, err = readSchemaVersion(db)
+		}
+	}
+	if err != nil {
+		if db != nil {
+			_ = db.Close()
+		}
+		return nil, err
+	}
+
+	return &sqliteStore{db: db, schemaVersion: version}, nil
+}
+
+// newInMemorySQLiteStore opens a shared-cache in-memory database for the
+// hot write path. A single connection is enforced (SetMaxOpenConns(1)):
+// file::memory:?cache=shared only shares the same database across
+// connections opened concurrently, and the last connection closing drops
+// the data, so database/sql's normal connection pooling would silently
+// lose writes.
+func newInMemorySQLiteStore(diskLocation string) (MappingStore, error) {
+	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		return nil, fmt.Errorf("store: opening in-memory sqlite database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	version, err := readSchemaVersion(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db, schemaVersion: version, inMemory: true, diskLocation: diskLocation}, nil
+}
+
+func openSQLiteReadWrite(location string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", location)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening sqlite database: %v", err)
+	}
+
+	// Bulk-write tuning: encode is a single-writer, single-pass job, so we
+	// trade durability for throughput.
+	optimizations := []string{
+		"PRAGMA journal_mode=OFF;",
+		"PRAGMA synchronous=OFF;",
+		"PRAGMA cache_size=1000000;",
+		"PRAGMA locking_mode=EXCLUSIVE;",
+		"PRAGMA temp_store=MEMORY;",
+	}
+	for _, opt := range optimizations {
+		if _, err := db.Exec(opt); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("store: setting %q: %v", opt, err)
+		}
+	}
+
+	return db, nil
+}
+
+func openSQLiteReadOnly(location string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", location+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("store: opening sqlite database: %v", err)
+	}
+
+	optimizations := []string{
+		"PRAGMA journal_mode=OFF;",
+		"PRAGMA synchronous=OFF;",
+		"PRAGMA cache_size=1000000;",
+		"PRAGMA temp_store=MEMORY;",
+		"PRAGMA mmap_size=52428800;", // 50MB
+	}
+	for _, opt := range optimizations {
+		if _, err := db.Exec(opt); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("store: setting %q: %v", opt, err)
+		}
+	}
+
+	return db, nil
+}
+
+func (s *sqliteStore) StorePair(newID, originalHeader string) error {
+	if _, err := s.db.Exec("INSERT OR REPLACE INTO mapping (new_id, original_header) VALUES (?, ?)", newID, originalHeader); err != nil {
+		return fmt.Errorf("store: inserting mapping: %v", err)
+	}
+	return nil
+}
+
+// Transact runs fn inside a single BEGIN/COMMIT, so a batch of StorePair
+// calls costs one fsync instead of one per row.
+func (s *sqliteStore) Transact(fn func(Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("store: beginning transaction: %v", err)
+	}
+
+	if err := fn(&sqliteTx{tx: tx}); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("store: transaction failed: %v (rollback also failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("store: committing transaction: %v", err)
+	}
+	return nil
+}
+
+// sqliteTx is the Tx passed into a sqliteStore.Transact callback.
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqliteTx) StorePair(newID, originalHeader string) error {
+	if _, err := t.tx.Exec("INSERT OR REPLACE INTO mapping (new_id, original_header) VALUES (?, ?)", newID, originalHeader); err != nil {
+		return fmt.Errorf("store: inserting mapping: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) LookupOriginalID(newID string) (string, error) {
+	query := fmt.Sprintf("SELECT %s FROM mapping WHERE new_id = ?", originalHeaderColumn(s.schemaVersion))
+	var originalHeader string
+	err := s.db.QueryRow(query, newID).Scan(&originalHeader)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("store: no mapping found for %s", newID)
+		}
+		return "", fmt.Errorf("store: looking up %s: %v", newID, err)
+	}
+	return originalHeader, nil
+}
+
+// LookupMany resolves newIDs with a single
+// "SELECT new_id, original_header FROM mapping WHERE new_id IN (...)"
+// instead of one round trip per ID.
+func (s *sqliteStore) LookupMany(newIDs []string) (map[string]string, error) {
+	if len(newIDs) == 0 {
+		return map[string]string{}, nil
+	}
+
+	placeholders := make([]string, len(newIDs))
+	args := make([]interface{}, len(newIDs))
+	for i, id := range newIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("SELECT new_id, %s FROM mapping WHERE new_id IN (%s)", originalHeaderColumn(s.schemaVersion), strings.Join(placeholders, ","))
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("store: batch querying mappings: %v", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]string, len(newIDs))
+	for rows.Next() {
+		var newID, originalHeader string
+		if err := rows.Scan(&newID, &originalHeader); err != nil {
+			return nil, fmt.Errorf("store: scanning row: %v", err)
+		}
+		found[newID] = originalHeader
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: iterating rows: %v", err)
+	}
+
+	return found, nil
+}
+
+func (s *sqliteStore) ReadAllMappings() (map[string]string, error) {
+	query := fmt.Sprintf("SELECT new_id, %s FROM mapping", originalHeaderColumn(s.schemaVersion))
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("store: querying mappings: %v", err)
+	}
+	defer rows.Close()
+
+	mapping := make(map[string]string)
+	for rows.Next() {
+		var newID, originalHeader string
+		if err := rows.Scan(&newID, &originalHeader); err != nil {
+			return nil, fmt.Errorf("store: scanning row: %v", err)
+		}
+		mapping[newID] = originalHeader
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: iterating rows: %v", err)
+	}
+
+	return mapping, nil
+}
+
+// Finalise analyzes the mapping table so sqlite's query planner has
+// up-to-date statistics for decode's lookups. There's no separate index to
+// build: new_id is already the table's PRIMARY KEY, which sqlite indexes
+// implicitly.
+func (s *sqliteStore) Finalise() error {
+	if s.inMemory {
+		return s.streamToDisk()
+	}
+
+	if _, err := s.db.Exec("ANALYZE mapping"); err != nil {
+		return fmt.Errorf("store: analyzing table: %v", err)
+	}
+	return nil
+}
+
+// streamToDisk copies the in-memory mapping table to diskLocation in a
+// single transaction via sqlite's ATTACH DATABASE, so the on-disk file
+// format seen by decode is unchanged by having written via InMemory. It
+// analyzes disk.mapping itself, before detaching, since by the time
+// Finalise would otherwise get around to it the disk database is no
+// longer attached and "mapping" refers only to the in-memory table that's
+// about to be discarded.
+func (s *sqliteStore) streamToDisk() error {
+	if dir := filepath.Dir(s.diskLocation); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("store: creating directory for %s: %v", s.diskLocation, err)
+		}
+	}
+
+	if _, err := s.db.Exec("ATTACH DATABASE ? AS disk", s.diskLocation); err != nil {
+		return fmt.Errorf("store: attaching disk database %s: %v", s.diskLocation, err)
+	}
+	defer s.db.Exec("DETACH DATABASE disk")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("store: beginning disk transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS disk.mapping (
+        new_id TEXT PRIMARY KEY,
+        original_header TEXT,
+        sequence_length INTEGER,
+        sha1_full TEXT,
+        created_at DATETIME
+    )`); err != nil {
+		return fmt.Errorf("store: creating disk table: %v", err)
+	}
+
+	if _, err := tx.Exec("INSERT OR REPLACE INTO disk.mapping SELECT * FROM mapping"); err != nil {
+		return fmt.Errorf("store: streaming in-memory mapping to disk: %v", err)
+	}
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS disk.schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("store: creating disk schema_version table: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM disk.schema_version"); err != nil {
+		return fmt.Errorf("store: recording disk schema version: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO disk.schema_version (version) VALUES (?)", s.schemaVersion); err != nil {
+		return fmt.Errorf("store: recording disk schema version: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("store: committing disk transaction: %v", err)
+	}
+
+	if _, err := s.db.Exec("ANALYZE disk.mapping"); err != nil {
+		return fmt.Errorf("store: analyzing disk table: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) InMemory() bool {
+	return s.inMemory
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
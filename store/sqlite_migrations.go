@@ -0,0 +1,148 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// currentSchemaVersion is the schema this binary writes. A mapping store
+// opened read-only with an older version keeps working against whatever
+// columns that version actually has; one opened for write is migrated up
+// to currentSchemaVersion before any inserts happen.
+const currentSchemaVersion = 2
+
+// migration applies one forward step of the sqlite schema. Migrations run
+// in version order inside a single transaction each, so a crash mid-run
+// leaves schema_version pointing at the last fully-applied step.
+type migration struct {
+	version int
+	apply   func(*sql.Tx) error
+}
+
+var migrations = []migration{
+	{version: 1, apply: migrateToV1},
+	{version: 2, apply: migrateToV2},
+}
+
+// migrateToV1 creates the original (new_id, original_header) mapping
+// table. Later migrations only ever add to it.
+func migrateToV1(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS mapping (
+        new_id TEXT PRIMARY KEY,
+        original_header TEXT
+    )`)
+	return err
+}
+
+// originalHeaderColumn returns the name of the column holding the original
+// header at the given schema version, so decode's read queries select
+// whatever a store at that version actually has on disk rather than
+// whatever the current binary would have written.
+//
+// Every version shipped so far (v1, v2) calls this column
+// "original_header", so this returns the same name regardless of version.
+// It takes version as a parameter anyway, rather than being a constant, so
+// that the day a migration renames this column, this is the single place
+// that needs a new case, not every read method in sqlite.go.
+func originalHeaderColumn(version int) string {
+	return "original_header"
+}
+
+// migrateToV2 adds the columns needed to verify a mapping without
+// re-reading the original FASTA: the untrimmed hash (to detect trim-length
+// collisions), the sequence length, and a write timestamp.
+func migrateToV2(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`ALTER TABLE mapping ADD COLUMN sequence_length INTEGER`,
+		`ALTER TABLE mapping ADD COLUMN sha1_full TEXT`,
+		`ALTER TABLE mapping ADD COLUMN created_at DATETIME`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSchemaVersion returns the schema version recorded in db, or 0 for a
+// store that predates the schema_version table.
+func readSchemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return 0, fmt.Errorf("store: creating schema_version table: %v", err)
+	}
+
+	var version int
+	err := db.QueryRow(`SELECT version FROM schema_version LIMIT 1`).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("store: reading schema version: %v", err)
+	}
+	return version, nil
+}
+
+// readSchemaVersionReadOnly is readSchemaVersion's read-only counterpart:
+// it never attempts to create schema_version, since a read-only connection
+// can't. A store opened before this request shipped has no such table and
+// reads back as version 0, which decode treats as the original
+// (new_id, original_header) shape.
+func readSchemaVersionReadOnly(db *sql.DB) (int, error) {
+	var name string
+	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='schema_version'`).Scan(&name)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("store: checking for schema_version table: %v", err)
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT version FROM schema_version LIMIT 1`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("store: reading schema version: %v", err)
+	}
+	return version, nil
+}
+
+// migrateSQLite brings db up to currentSchemaVersion, applying each
+// outstanding migration in its own transaction and recording progress in
+// schema_version as it goes.
+func migrateSQLite(db *sql.DB) error {
+	version, err := readSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("store: beginning migration to v%d: %v", m.version, err)
+		}
+
+		if err := m.apply(tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("store: migrating to v%d: %v", m.version, err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("store: recording schema version %d: %v", m.version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, m.version); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("store: recording schema version %d: %v", m.version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("store: committing migration to v%d: %v", m.version, err)
+		}
+
+		version = m.version
+	}
+
+	return nil
+}
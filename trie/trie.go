@@ -0,0 +1,156 @@
+// Package trie implements a compact Aho-Corasick automaton for finding
+// every occurrence of a fixed set of encoded IDs in a line of text in a
+// single pass, rather than re-scanning the line once per candidate ID.
+package trie
+
+import "sort"
+
+// Match describes one occurrence of a registered pattern within a line.
+type Match struct {
+	// Start and End are the byte offsets of the match in the line
+	// searched, as a half-open range [Start, End).
+	Start, End int
+
+	// Pattern is the matched string itself, suitable for use as a map
+	// key against the original mapping.
+	Pattern string
+}
+
+type node struct {
+	children map[byte]*node
+	fail     *node
+	// word is non-empty when this node terminates a registered pattern.
+	word string
+	// outputs collects word (if set) plus every word reachable by
+	// following fail links, so a single visit to this node yields every
+	// pattern ending here.
+	outputs []string
+}
+
+// Trie is an Aho-Corasick automaton built once from a fixed set of
+// patterns (here, every new_id in the mapping store) and then reused to
+// scan many lines without rebuilding.
+type Trie struct {
+	root *node
+}
+
+// New builds a Trie over patterns. Patterns must be non-empty; empty
+// strings are ignored.
+func New(patterns []string) *Trie {
+	root := &node{children: make(map[byte]*node)}
+
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		cur := root
+		for i := 0; i < len(p); i++ {
+			c := p[i]
+			next, ok := cur.children[c]
+			if !ok {
+				next = &node{children: make(map[byte]*node)}
+				cur.children[c] = next
+			}
+			cur = next
+		}
+		cur.word = p
+	}
+
+	buildFailLinks(root)
+	return &Trie{root: root}
+}
+
+// buildFailLinks computes the standard Aho-Corasick failure function via
+// BFS, and accumulates outputs along fail links so every match ending at
+// a node is discoverable without walking the chain at search time.
+func buildFailLinks(root *node) {
+	root.fail = root
+	queue := make([]*node, 0, len(root.children))
+
+	for _, child := range root.children {
+		child.fail = root
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if cur.word != "" {
+			cur.outputs = append(cur.outputs, cur.word)
+		}
+		cur.outputs = append(cur.outputs, cur.fail.outputs...)
+
+		for c, child := range cur.children {
+			fail := cur.fail
+			for fail != root {
+				if next, ok := fail.children[c]; ok {
+					child.fail = next
+					break
+				}
+				fail = fail.fail
+			}
+			if child.fail == nil {
+				if next, ok := root.children[c]; ok && next != child {
+					child.fail = next
+				} else {
+					child.fail = root
+				}
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// FindAll returns every non-overlapping occurrence of a registered pattern
+// in line, in order, resolving overlaps with leftmost-longest semantics: a
+// match starting earlier always wins over one starting later, even if the
+// later one would otherwise end first; ties at the same start are broken
+// in favour of the longer match. Encoded IDs routinely have this shape —
+// e.g. with a short or collision-extended -trim, "9_PW_sha1_1" can be a
+// genuine substring starting inside "19_PW_sha1_188fa" — so scanning
+// purely in end-position order (as the automaton naturally visits matches)
+// would let the shorter, later-ending match shadow the one that should
+// have matched.
+func (t *Trie) FindAll(line []byte) []Match {
+	var candidates []Match
+	cur := t.root
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		for cur != t.root {
+			if _, ok := cur.children[c]; ok {
+				break
+			}
+			cur = cur.fail
+		}
+		if next, ok := cur.children[c]; ok {
+			cur = next
+		}
+
+		for _, word := range cur.outputs {
+			start := i - len(word) + 1
+			candidates = append(candidates, Match{Start: start, End: i + 1, Pattern: word})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Start != candidates[j].Start {
+			return candidates[i].Start < candidates[j].Start
+		}
+		return candidates[i].End > candidates[j].End
+	})
+
+	var matches []Match
+	consumedUntil := 0
+	for _, m := range candidates {
+		if m.Start < consumedUntil {
+			continue
+		}
+		matches = append(matches, m)
+		consumedUntil = m.End
+	}
+
+	return matches
+}